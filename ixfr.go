@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/miekg/dns"
+	"github.com/polymorpher/coredns-redis/record"
+)
+
+// journalRetention bounds how many serial-to-serial deltas are kept per
+// zone; secondaries that fall further behind than this get a full AXFR
+// instead of an IXFR.
+const journalRetention = 100
+
+func (r *Redis) journalKey(zone string) string {
+	return r.KeyPrefix + "ixfr:" + zone
+}
+
+// journalWire is the JSON-safe encoding of a record.IXFRChange: dns.RR is an
+// interface, so its members round-trip through their presentation-format
+// string rather than encoding/json.
+type journalWire struct {
+	OldSOA string   `json:"old_soa"`
+	NewSOA string   `json:"new_soa"`
+	Remove []string `json:"remove,omitempty"`
+	Add    []string `json:"add,omitempty"`
+}
+
+func encodeChange(change record.IXFRChange) (string, error) {
+	w := journalWire{
+		OldSOA: change.OldSOA.String(),
+		NewSOA: change.NewSOA.String(),
+	}
+	for _, rr := range change.Remove {
+		w.Remove = append(w.Remove, rr.String())
+	}
+	for _, rr := range change.Add {
+		w.Add = append(w.Add, rr.String())
+	}
+	buf, err := json.Marshal(w)
+	return string(buf), err
+}
+
+func decodeChange(raw string) (record.IXFRChange, error) {
+	var w journalWire
+	if err := json.Unmarshal([]byte(raw), &w); err != nil {
+		return record.IXFRChange{}, err
+	}
+
+	oldSOA, err := parseSOA(w.OldSOA)
+	if err != nil {
+		return record.IXFRChange{}, fmt.Errorf("decode journal old SOA: %w", err)
+	}
+	newSOA, err := parseSOA(w.NewSOA)
+	if err != nil {
+		return record.IXFRChange{}, fmt.Errorf("decode journal new SOA: %w", err)
+	}
+
+	change := record.IXFRChange{OldSOA: oldSOA, NewSOA: newSOA}
+	for _, s := range w.Remove {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			return record.IXFRChange{}, fmt.Errorf("decode journal removed RR %q: %w", s, err)
+		}
+		change.Remove = append(change.Remove, rr)
+	}
+	for _, s := range w.Add {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			return record.IXFRChange{}, fmt.Errorf("decode journal added RR %q: %w", s, err)
+		}
+		change.Add = append(change.Add, rr)
+	}
+	return change, nil
+}
+
+func parseSOA(s string) (*dns.SOA, error) {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		return nil, err
+	}
+	soa, ok := rr.(*dns.SOA)
+	if !ok {
+		return nil, fmt.Errorf("not a SOA record: %q", s)
+	}
+	return soa, nil
+}
+
+// SaveIXFRJournal records one serial-to-serial delta for zone, keyed by the
+// new serial, trimming the journal back to journalRetention entries.
+func (r *Redis) SaveIXFRJournal(ctx context.Context, zone string, serial uint32, change record.IXFRChange) error {
+	member, err := encodeChange(change)
+	if err != nil {
+		return err
+	}
+
+	key := r.journalKey(zone)
+	pipe := r.Client.Pipeline()
+	pipe.ZAdd(ctx, key, &goredis.Z{Score: float64(serial), Member: member})
+	pipe.ZRemRangeByRank(ctx, key, 0, -int64(journalRetention)-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// LoadIXFRJournal returns every recorded change for zone with a new serial
+// in (fromSerial, toSerial], ordered oldest-first, or an empty slice if
+// fromSerial has fallen out of the retained journal.
+func (r *Redis) LoadIXFRJournal(ctx context.Context, zone string, fromSerial, toSerial uint32) ([]record.IXFRChange, error) {
+	key := r.journalKey(zone)
+	members, err := r.Client.ZRangeByScore(ctx, key, &goredis.ZRangeBy{
+		Min: fmt.Sprintf("(%d", fromSerial),
+		Max: fmt.Sprintf("%d", toSerial),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]record.IXFRChange, 0, len(members))
+	for _, m := range members {
+		change, err := decodeChange(m)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) > 0 && changes[0].OldSOA.Serial != fromSerial {
+		return []record.IXFRChange{}, nil
+	}
+	return changes, nil
+}
@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"strings"
+)
+
+// KeyspaceEvent is a single Redis keyspace notification, decoded from the
+// `__keyspace@<db>__:<key>` channel name and its payload (the command that
+// fired it, e.g. "set", "hset", "del").
+type KeyspaceEvent struct {
+	Key   string
+	Event string
+}
+
+// keyspaceFlags are the notify-keyspace-events classes the plugin needs:
+// K (keyspace-prefixed events), g (generic commands, for DEL) and h (hash
+// commands, for HSET - zones are stored as hashes).
+const keyspaceFlags = "Kgh"
+
+// EnsureKeyspaceNotifications checks whether the server's
+// notify-keyspace-events config already covers keyspaceFlags, enabling it if
+// not. It reports false (with no error) if the server refuses the CONFIG SET,
+// e.g. because it's a managed instance with CONFIG disabled.
+func (r *Redis) EnsureKeyspaceNotifications(ctx context.Context) (bool, error) {
+	cur, err := r.configGet(ctx, "notify-keyspace-events")
+	if err != nil {
+		return false, err
+	}
+	if hasKeyspaceFlags(cur) {
+		return true, nil
+	}
+
+	wanted := mergeFlags(cur, keyspaceFlags)
+	if err := r.Client.ConfigSet(ctx, "notify-keyspace-events", wanted).Err(); err != nil {
+		log.Warningf("unable to set notify-keyspace-events: %v", err)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (r *Redis) configGet(ctx context.Context, param string) (string, error) {
+	res, err := r.Client.ConfigGet(ctx, param).Result()
+	if err != nil {
+		return "", err
+	}
+	// go-redis returns [param, value, ...] for CONFIG GET.
+	for i := 0; i+1 < len(res); i += 2 {
+		if res[i] == param {
+			return res[i+1], nil
+		}
+	}
+	return "", nil
+}
+
+func hasKeyspaceFlags(cur string) bool {
+	if !strings.Contains(cur, "K") {
+		return false
+	}
+	if strings.ContainsAny(cur, "A") {
+		return true
+	}
+	for _, f := range keyspaceFlags {
+		if f == 'K' {
+			continue
+		}
+		if !strings.ContainsRune(cur, f) {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeFlags(cur, add string) string {
+	have := make(map[rune]struct{}, len(cur))
+	for _, c := range cur {
+		have[c] = struct{}{}
+	}
+	out := cur
+	for _, c := range add {
+		if _, ok := have[c]; !ok {
+			out += string(c)
+			have[c] = struct{}{}
+		}
+	}
+	return out
+}
+
+// SubscribeKeyspace subscribes to keyspace notifications for keys matching
+// pattern and returns a channel of decoded events, and a closer to tear the
+// subscription down. The channel is closed when ctx is cancelled or the
+// underlying pub/sub connection drops.
+func (r *Redis) SubscribeKeyspace(ctx context.Context, pattern string) (<-chan KeyspaceEvent, func(), error) {
+	sub := r.Client.PSubscribe(ctx, "__keyspace@*__:"+pattern)
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, nil, err
+	}
+
+	out := make(chan KeyspaceEvent)
+	go func() {
+		defer close(out)
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				const prefix = "__keyspace@"
+				key := msg.Channel
+				if i := strings.Index(key, "__:"); i >= 0 {
+					key = key[i+3:]
+				} else if strings.HasPrefix(key, prefix) {
+					key = strings.TrimPrefix(key, prefix)
+				}
+				select {
+				case out <- KeyspaceEvent{Key: key, Event: msg.Payload}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, func() { _ = sub.Close() }, nil
+}
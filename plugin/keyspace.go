@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	redis "github.com/polymorpher/coredns-redis"
+)
+
+var (
+	keyspaceEventsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "coredns",
+		Subsystem: "redis",
+		Name:      "keyspace_events_total",
+		Help:      "Counter of Redis keyspace notification events received.",
+	})
+	fullReloadsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "coredns",
+		Subsystem: "redis",
+		Name:      "full_reloads_total",
+		Help:      "Counter of full zone-name cache reloads (the startup load and each poll-ticker refresh).",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(keyspaceEventsTotal, fullReloadsTotal)
+}
+
+// startKeyspaceListener subscribes to Redis keyspace notifications for the
+// zone key space and surgically patches p.zones as events arrive, instead of
+// waiting on the poll ticker in startZoneNameCache. It runs until ctx is
+// cancelled and falls back to the existing ticker path whenever the
+// subscription can't be established.
+func (p *Plugin) startKeyspaceListener(ctx context.Context) {
+	if ok, err := p.Redis.EnsureKeyspaceNotifications(ctx); err != nil {
+		log.Warningf("could not verify notify-keyspace-events, falling back to polling: %v", err)
+		return
+	} else if !ok {
+		log.Warning("keyspace notifications are disabled on the Redis server (notify-keyspace-events); falling back to polling")
+		return
+	}
+
+	events, closer, err := p.Redis.SubscribeKeyspace(ctx, p.Redis.KeyPrefix+"*")
+	if err != nil {
+		log.Warningf("unable to subscribe to keyspace notifications, falling back to polling: %v", err)
+		return
+	}
+	defer closer()
+
+	log.Info("listening for Redis keyspace notifications")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				log.Warning("keyspace notification subscription closed, falling back to polling")
+				return
+			}
+			p.handleKeyspaceEvent(ctx, ev)
+		}
+	}
+}
+
+func (p *Plugin) handleKeyspaceEvent(ctx context.Context, ev redis.KeyspaceEvent) {
+	fqdn := strings.TrimSuffix(strings.TrimPrefix(ev.Key, p.Redis.KeyPrefix), ".") + "."
+	keyspaceEventsTotal.Inc()
+
+	switch ev.Event {
+	case "set", "hset":
+		if _, err := p.invalidateZone(ctx, fqdn); err != nil {
+			log.Warningf("failed to invalidate zone %s after keyspace event: %v", fqdn, err)
+		}
+		p.invalidateCacheFor(fqdn)
+	case "del":
+		p.removeZone(fqdn)
+		p.invalidateCacheFor(fqdn)
+	}
+}
+
+// invalidateCacheFor drops the LRU entry the keyspace event key maps to: the
+// whole zone if fqdn names a zone apex, otherwise just that location within
+// its owning zone.
+func (p *Plugin) invalidateCacheFor(fqdn string) {
+	store := p.cache()
+	if store == nil {
+		return
+	}
+
+	p.lock.Lock()
+	zones := append([]string(nil), p.zones...)
+	p.lock.Unlock()
+
+	zoneName := plugin.Zones(zones).Matches(fqdn)
+	if zoneName == "" || zoneName == fqdn {
+		store.InvalidateZone(fqdn)
+		return
+	}
+	location := strings.TrimSuffix(fqdn, "."+zoneName)
+	store.InvalidateLocation(zoneName, location)
+}
+
+// invalidateZone reloads fqdn from Redis and patches it into p.zones in
+// place, avoiding a full sorted-slice rebuild. It returns whether fqdn was
+// newly added to the cache.
+func (p *Plugin) invalidateZone(ctx context.Context, fqdn string) (bool, error) {
+	return p.loadCacheForZone(ctx, fqdn)
+}
+
+// removeZone drops fqdn from p.zones after a Redis `del` keyspace event.
+func (p *Plugin) removeZone(fqdn string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pos := sort.SearchStrings(p.zones, fqdn)
+	if pos >= len(p.zones) || p.zones[pos] != fqdn {
+		return
+	}
+	p.zones = append(p.zones[:pos], p.zones[pos+1:]...)
+	delete(p.zoneSerials, fqdn)
+	delete(p.zoneRRs, fqdn)
+}
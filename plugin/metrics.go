@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	redis "github.com/polymorpher/coredns-redis"
+	"github.com/polymorpher/coredns-redis/record"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "coredns",
+		Subsystem: "redis",
+		Name:      "requests_total",
+		Help:      "Counter of DNS requests handled by the redis plugin, by zone, qtype and rcode.",
+	}, []string{"zone", "qtype", "rcode"})
+
+	backendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "coredns",
+		Subsystem: "redis",
+		Name:      "backend_duration_seconds",
+		Help:      "Histogram of Redis backend call latency, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op"})
+
+	externalLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "coredns",
+		Subsystem: "redis",
+		Name:      "external_lookups_total",
+		Help:      "Counter of externalLookup (CNAME chase) calls, by result.",
+	}, []string{"result"})
+
+	zoneCacheZones = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "coredns",
+		Subsystem: "redis",
+		Name:      "zone_cache_zones",
+		Help:      "Number of zone names currently held in the zone-name cache.",
+	})
+
+	zoneCacheLastRefresh = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "coredns",
+		Subsystem: "redis",
+		Name:      "zone_cache_last_refresh_seconds",
+		Help:      "Unix timestamp of the last successful zone-name cache refresh.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, backendDuration, externalLookupsTotal, zoneCacheZones, zoneCacheLastRefresh)
+}
+
+// observeBackend times a Redis backend call and records it under op; call
+// the returned func when the call returns, typically via defer.
+func observeBackend(op string) func() {
+	start := time.Now()
+	return func() {
+		backendDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	}
+}
+
+func resultLabel(r Result) string {
+	switch r {
+	case Success:
+		return "success"
+	case NameError:
+		return "name_error"
+	case Delegation:
+		return "delegation"
+	case NoData:
+		return "no_data"
+	case ServerFailure:
+		return "server_failure"
+	default:
+		return "unknown"
+	}
+}
+
+// qtypeLabel maps qtype to its mnemonic, or "other" for anything
+// dns.TypeToString doesn't know. qtype comes straight off the wire, so
+// echoing it as a raw number here would let a client force up to 65536
+// distinct label values into requestsTotal - a metrics-cardinality
+// exhaustion vector client_golang never evicts.
+func qtypeLabel(qtype uint16) string {
+	if s, ok := dns.TypeToString[qtype]; ok {
+		return s
+	}
+	return "other"
+}
+
+// instrumentedBackend wraps *redis.Redis so the LoadZoneC/LoadZoneRecordsC
+// calls a LayeredStore makes on a cache miss are timed into
+// backendDuration. loadZone/loadZoneRecords time their own direct fallback
+// calls; other direct p.Redis calls (e.g. in checkSerialAndNotify) are not
+// timed.
+type instrumentedBackend struct {
+	redis *redis.Redis
+}
+
+func (b *instrumentedBackend) LoadZoneC(ctx context.Context, name string, noCache bool) *record.Zone {
+	defer observeBackend("load_zone")()
+	return b.redis.LoadZoneC(ctx, name, noCache)
+}
+
+func (b *instrumentedBackend) LoadZoneRecordsC(ctx context.Context, location string, zone *record.Zone) *record.Records {
+	defer observeBackend("load_records")()
+	return b.redis.LoadZoneRecordsC(ctx, location, zone)
+}
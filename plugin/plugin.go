@@ -7,11 +7,11 @@ import (
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/request"
-	redisCon "github.com/gomodule/redigo/redis"
 	"github.com/miekg/dns"
 	redis "github.com/polymorpher/coredns-redis"
 	"github.com/polymorpher/coredns-redis/record"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -51,10 +51,85 @@ type Plugin struct {
 
 	loadZoneTicker *time.Ticker
 	zones          []string
-	lastRefresh    time.Time
-	lock           sync.Mutex
+	zoneSerials    map[string]uint32
+	// zoneRRs holds the last-seen full RR set for each zone, diffed against
+	// the current one in checkSerialAndNotify to build the IXFR journal
+	// entry for a serial bump.
+	zoneRRs     map[string][]dns.RR
+	lastRefresh time.Time
+	lock        sync.Mutex
 	// Upstream for looking up external names during the resolution process.
 	Upstream *upstream.Upstream
+	// TransferPolicy gates AXFR/IXFR requests and outbound NOTIFY, built
+	// from the `to`, `tsig` and `notify` lines of the Corefile `redis`
+	// block; there is no separate `transfer` block.
+	TransferPolicy *TransferPolicy
+	// KeyspaceNotifications enables the pub/sub cache-invalidation path
+	// (Corefile `keyspace_notifications yes`) in addition to the poll
+	// ticker (loadZoneTicker above).
+	KeyspaceNotifications bool
+
+	// CacheSize and CacheNegative configure the in-process LRU in front of
+	// Redis (Corefile `cache_size N` / `cache_negative_ttl DURATION`; the
+	// two-word `cache size` / `cache negative` forms are not parsed); zero
+	// means the built-in defaults below.
+	CacheSize     int
+	CacheNegative time.Duration
+	store         record.Store
+	storeOnce     sync.Once
+
+	// zoneCacheOnce guards startZoneNameCache so a Redis hiccup that stalls
+	// lastRefresh doesn't leak a new ticker goroutine and keyspace-listener
+	// subscription every time a later DNS miss calls checkCache again.
+	zoneCacheOnce sync.Once
+}
+
+const (
+	defaultCacheSize     = 10000
+	defaultCacheNegative = 30 * time.Second
+)
+
+// cache lazily builds the layered LRU-over-Redis store the first time it's
+// needed, so the plugin works whether or not setup.go wired one in. It is
+// kept off the zones lock so it doesn't add contention to the DNS hot path.
+func (p *Plugin) cache() record.Store {
+	p.storeOnce.Do(func() {
+		size, negative := p.CacheSize, p.CacheNegative
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+		if negative <= 0 {
+			negative = defaultCacheNegative
+		}
+		s, err := record.NewLayeredStore(&instrumentedBackend{redis: p.Redis}, size, negative, p.Redis.DefaultTtl)
+		if err != nil {
+			log.Errorf("unable to build zone cache, falling back to direct Redis access: %v", err)
+			return
+		}
+		p.store = s
+	})
+	return p.store
+}
+
+// loadZone fetches zone metadata through the layered cache when one is
+// available, falling back to a direct Redis read otherwise.
+func (p *Plugin) loadZone(ctx context.Context, zoneName string) *record.Zone {
+	if s := p.cache(); s != nil {
+		return s.GetZone(ctx, zoneName)
+	}
+	defer observeBackend("load_zone")()
+	return p.Redis.LoadZoneC(ctx, zoneName, false)
+}
+
+// loadZoneRecords fetches the decoded records for location through the
+// layered cache when one is available, falling back to a direct Redis read
+// otherwise.
+func (p *Plugin) loadZoneRecords(ctx context.Context, zone *record.Zone, location string, qtype uint16) *record.Records {
+	if s := p.cache(); s != nil {
+		return s.GetLocation(ctx, zone, location, qtype)
+	}
+	defer observeBackend("load_records")()
+	return p.Redis.LoadZoneRecordsC(ctx, location, zone)
 }
 
 func (p *Plugin) Name() string {
@@ -62,7 +137,7 @@ func (p *Plugin) Name() string {
 }
 
 func (p *Plugin) Ready() bool {
-	ok, err := p.Redis.Ping()
+	ok, err := p.Redis.Ping(context.Background())
 	if err != nil {
 		log.Error(err)
 	}
@@ -70,6 +145,12 @@ func (p *Plugin) Ready() bool {
 }
 
 func (p *Plugin) externalLookup(ctx context.Context, state request.Request, target string, qtype uint16) ([]dns.RR, Result) {
+	rr, result := p.doExternalLookup(ctx, state, target, qtype)
+	externalLookupsTotal.WithLabelValues(resultLabel(result)).Inc()
+	return rr, result
+}
+
+func (p *Plugin) doExternalLookup(ctx context.Context, state request.Request, target string, qtype uint16) ([]dns.RR, Result) {
 	m, e := p.Upstream.Lookup(ctx, state, target, qtype)
 	if e != nil {
 		return nil, ServerFailure
@@ -89,29 +170,28 @@ func (p *Plugin) externalLookup(ctx context.Context, state request.Request, targ
 	return m.Answer, Success
 }
 
-func (p *Plugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+func (p *Plugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (rcode int, err error) {
 	state := request.Request{Req: r, W: w}
 	qName := state.Name()
 	qType := state.QType()
 
-	if qName == "" || qType == dns.TypeNone {
-		return plugin.NextOrFailure(qName, p.Next, ctx, w, r)
-	}
-
-	var conn redisCon.Conn
+	var zoneName string
 	defer func() {
-		if conn == nil {
-			return
+		zoneLabel := zoneName
+		if zoneLabel == "" {
+			zoneLabel = "."
 		}
-		_ = conn.Close()
+		requestsTotal.WithLabelValues(zoneLabel, qtypeLabel(qType), strconv.Itoa(rcode)).Inc()
 	}()
 
-	var zoneName string
+	if qName == "" || qType == dns.TypeNone {
+		return plugin.NextOrFailure(qName, p.Next, ctx, w, r)
+	}
+
 	x := sort.SearchStrings(p.zones, qName)
 	if x < len(p.zones) && p.zones[x] == qName {
 		zoneName = p.zones[x]
 	} else {
-		conn = p.Redis.Pool.Get()
 		zoneName = plugin.Zones(p.zones).Matches(qName)
 	}
 
@@ -119,72 +199,64 @@ func (p *Plugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		log.Debugf("zone not found: %s", qName)
 		p.checkCache()
 		return plugin.NextOrFailure(qName, p.Next, ctx, w, r)
-	} else if conn == nil {
-		conn = p.Redis.Pool.Get()
 	}
 
-	zone := p.Redis.LoadZoneC(zoneName, false, conn)
+	zone := p.loadZone(ctx, zoneName)
 	if zone == nil {
 		log.Errorf("unable to load zone: %s", zoneName)
 		return p.Redis.ErrorResponse(state, zoneName, dns.RcodeServerFailure, nil)
 	}
 
-	if qType == dns.TypeAXFR {
+	if qType == dns.TypeAXFR || qType == dns.TypeIXFR {
+		if !p.transferAllowed(state, r) {
+			return dns.RcodeRefused, nil
+		}
+		if qType == dns.TypeIXFR {
+			log.Debug("incremental zone transfer request (Handler)")
+			zoneRecords := p.loadZoneRecords(ctx, zone, "@", qType)
+			zoneRecords.MakeFqdn(zone.Name)
+			return p.handleIXFR(ctx, zone, zoneRecords, w, r)
+		}
 		log.Debug("zone transfer request (Handler)")
-		return p.handleZoneTransfer(zone, p.zones, w, r, conn)
+		return p.handleZoneTransfer(ctx, zone, p.zones, w, r)
 	}
 
-	location := p.Redis.FindLocation(qName, zone)
+	location := p.Redis.FindLocation(ctx, qName, zone)
 	if location == "" {
 		log.Debugf("location %s not found for zone: %s", qName, zone)
 		p.checkCache()
 		return p.Redis.ErrorResponse(state, zoneName, dns.RcodeNameError, nil)
 	}
 
-	answers := make([]dns.RR, 0, 0)
-	extras := make([]dns.RR, 0, 10)
-	zoneRecords := p.Redis.LoadZoneRecordsC(location, zone, conn)
+	zoneRecords := p.loadZoneRecords(ctx, zone, location, qType)
 	zoneRecords.MakeFqdn(zone.Name)
 
 	answerCode := dns.RcodeSuccess
+	var answers, extras []dns.RR
 
 	if qType != dns.TypeCNAME && len(zoneRecords.CNAME) > 0 {
 		answers, extras = p.Redis.CNAME(qName, zone, zoneRecords)
 		targetName := answers[0].(*dns.CNAME).Target
-		log.Debugf("Doing external (%s) recursive CNAME lookup for %s in zone %s", targetName, qName, zone)
-		rr, result := p.externalLookup(ctx, state, targetName, qType)
-		// note that we should still write an answer even if external lookup fails, but we should propagate external lookup errors back to answer as well
+		log.Debugf("Doing recursive CNAME lookup for %s -> %s in zone %s", qName, targetName, zone)
+
+		res := newResolver(ctx, p, state)
+		res.visited[resolveKey{name: qName, qtype: qType}] = struct{}{}
+		chased, chasedExtras, result := res.resolve(targetName, qType)
 		if result != Success {
-			log.Debugf("External lookup failed for name %s in zone %s", qName, zone)
+			log.Debugf("CNAME chase for %s failed resolving %s: %s", qName, targetName, resultLabel(result))
 		}
 		answerCode = result.toRcode()
-		answers = append(answers, rr...)
+		answers = append(answers, chased...)
+		extras = append(extras, chasedExtras...)
 	} else {
-		switch qType {
-		case dns.TypeSOA:
-			answers, extras = p.Redis.SOA(zone, zoneRecords)
-		case dns.TypeA:
-			answers, extras = p.Redis.A(qName, zone, zoneRecords)
-		case dns.TypeAAAA:
-			answers, extras = p.Redis.AAAA(qName, zone, zoneRecords)
-		case dns.TypeCNAME:
-			answers, extras = p.Redis.CNAME(qName, zone, zoneRecords)
-		case dns.TypeTXT:
-			answers, extras = p.Redis.TXT(qName, zone, zoneRecords)
-		case dns.TypeNS:
-			answers, extras = p.Redis.NS(qName, zone, zoneRecords, p.zones, conn)
-		case dns.TypeMX:
-			answers, extras = p.Redis.MX(qName, zone, zoneRecords, p.zones, conn)
-		case dns.TypeSRV:
-			answers, extras = p.Redis.SRV(qName, zone, zoneRecords, p.zones, conn)
-		case dns.TypePTR:
-			answers, extras = p.Redis.PTR(qName, zone, zoneRecords, p.zones, conn)
-		case dns.TypeCAA:
-			answers, extras = p.Redis.CAA(qName, zone, zoneRecords)
-
-		default:
+		var ok bool
+		answers, extras, ok = p.buildAnswer(ctx, zone, zoneRecords, qName, qType)
+		if !ok {
 			return p.Redis.ErrorResponse(state, zoneName, dns.RcodeNotImplemented, nil)
 		}
+		if qType == dns.TypeNS || qType == dns.TypeMX || qType == dns.TypeSRV {
+			extras = p.fillGlue(ctx, state, answers, extras)
+		}
 	}
 
 	m := new(dns.Msg)
@@ -198,12 +270,44 @@ func (p *Plugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	return answerCode, nil
 }
 
-func (p *Plugin) handleZoneTransfer(zone *record.Zone, zones []string, w dns.ResponseWriter, r *dns.Msg, conn redisCon.Conn) (int, error) {
-	//todo: check and test zone transfer, implement ip-range check
-	records := p.Redis.AXFR(zone, zones, conn)
+// buildAnswer decodes zoneRecords into the answer (and, for some types,
+// extra/glue) RRs for qType. ok is false for a qType the plugin doesn't
+// serve, in which case the caller should answer RcodeNotImplemented.
+func (p *Plugin) buildAnswer(ctx context.Context, zone *record.Zone, zoneRecords *record.Records, qName string, qType uint16) (answers, extras []dns.RR, ok bool) {
+	switch qType {
+	case dns.TypeSOA:
+		answers, extras = p.Redis.SOA(zone, zoneRecords)
+	case dns.TypeA:
+		answers, extras = p.Redis.A(qName, zone, zoneRecords)
+	case dns.TypeAAAA:
+		answers, extras = p.Redis.AAAA(qName, zone, zoneRecords)
+	case dns.TypeCNAME:
+		answers, extras = p.Redis.CNAME(qName, zone, zoneRecords)
+	case dns.TypeTXT:
+		answers, extras = p.Redis.TXT(qName, zone, zoneRecords)
+	case dns.TypeNS:
+		answers, extras = p.Redis.NS(ctx, qName, zone, zoneRecords, p.zones)
+	case dns.TypeMX:
+		answers, extras = p.Redis.MX(ctx, qName, zone, zoneRecords, p.zones)
+	case dns.TypeSRV:
+		answers, extras = p.Redis.SRV(ctx, qName, zone, zoneRecords, p.zones)
+	case dns.TypePTR:
+		answers, extras = p.Redis.PTR(ctx, qName, zone, zoneRecords, p.zones)
+	case dns.TypeCAA:
+		answers, extras = p.Redis.CAA(qName, zone, zoneRecords)
+	default:
+		return nil, nil, false
+	}
+	return answers, extras, true
+}
+
+func (p *Plugin) handleZoneTransfer(ctx context.Context, zone *record.Zone, zones []string, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	axfrDone := observeBackend("axfr")
+	records := p.Redis.AXFR(ctx, zone, zones)
+	axfrDone()
 	ch := make(chan *dns.Envelope)
 	tr := new(dns.Transfer)
-	tr.TsigSecret = nil
+	tr.TsigSecret = p.TransferPolicy.tsigSecrets()
 	go func(ch chan *dns.Envelope) {
 		j, l := 0, 0
 
@@ -229,13 +333,29 @@ func (p *Plugin) handleZoneTransfer(zone *record.Zone, zones []string, w dns.Res
 	return dns.RcodeSuccess, nil
 }
 
+// startZoneNameCache loads the zone-name cache and starts the goroutines
+// that keep it fresh (the poll ticker, and the keyspace listener if
+// configured). It runs its startup work at most once per Plugin: it's
+// called both at CoreDNS startup and, via checkCache, from the DNS hot path
+// whenever the cache looks stale, and without the guard a Redis hiccup that
+// stalls lastRefresh (the ticker goroutine returns for good on its first
+// error) would leak one more permanent ticker/listener goroutine pair per
+// later cache-miss.
 func (p *Plugin) startZoneNameCache() {
+	p.zoneCacheOnce.Do(p.runZoneNameCache)
+}
 
+func (p *Plugin) runZoneNameCache() {
 	if err := p.loadCache(); err != nil {
 		log.Fatal("unable to load zones to cache", err)
 	} else {
 		log.Info("zone name cache loaded")
 	}
+
+	if p.KeyspaceNotifications {
+		go p.startKeyspaceListener(context.Background())
+	}
+
 	go func() {
 		for {
 			select {
@@ -261,11 +381,23 @@ func (p *Plugin) loadCache() error {
 	p.zones = z
 	p.lastRefresh = time.Now()
 	p.lock.Unlock()
+	fullReloadsTotal.Inc()
+	zoneCacheZones.Set(float64(len(z)))
+	zoneCacheLastRefresh.Set(float64(p.lastRefresh.Unix()))
+
+	// Check every zone's serial here too, not just in loadCacheForZone: that
+	// path is only ever reached via the keyspace listener, so without this
+	// NOTIFY would never fire for a standalone setup (no
+	// keyspace_notifications configured) no matter how many serials bumped.
+	ctx := context.Background()
+	for _, zoneName := range z {
+		p.checkSerialAndNotify(ctx, zoneName)
+	}
 	return nil
 }
 
 // TODO: we should use a heap for p.zones so we don't keep duplicating the slice each time this function is called
-func (p *Plugin) loadCacheForZone(fqdn string) (bool, error) {
+func (p *Plugin) loadCacheForZone(ctx context.Context, fqdn string) (bool, error) {
 	exists, err := p.Redis.CheckZoneName(fqdn)
 	if err != nil {
 		return false, err
@@ -273,10 +405,13 @@ func (p *Plugin) loadCacheForZone(fqdn string) (bool, error) {
 	if !exists {
 		return false, fmt.Errorf("zone does not exist: %s", fqdn)
 	}
+
+	p.checkSerialAndNotify(ctx, fqdn)
+
 	p.lock.Lock()
 	defer p.lock.Unlock()
 	pos := sort.SearchStrings(p.zones, fqdn)
-	if p.zones[pos] == fqdn {
+	if pos < len(p.zones) && p.zones[pos] == fqdn {
 		return false, nil
 	}
 	p.zones = append(p.zones, "")
@@ -285,6 +420,131 @@ func (p *Plugin) loadCacheForZone(fqdn string) (bool, error) {
 	return true, nil
 }
 
+// checkSerialAndNotify reloads the zone's SOA and, whenever its serial has
+// increased since the last time this zone was observed, records the diff
+// against the previously seen RR set as an IXFR journal entry and fires an
+// outbound NOTIFY to the configured peers.
+func (p *Plugin) checkSerialAndNotify(ctx context.Context, fqdn string) {
+	zone := p.Redis.LoadZoneC(ctx, fqdn, false)
+	if zone == nil {
+		return
+	}
+	zoneRecords := p.Redis.LoadZoneRecordsC(ctx, "@", zone)
+	zoneRecords.MakeFqdn(zone.Name)
+	answers, _ := p.Redis.SOA(zone, zoneRecords)
+	if len(answers) == 0 {
+		return
+	}
+	soa, ok := answers[0].(*dns.SOA)
+	if !ok {
+		return
+	}
+
+	p.lock.Lock()
+	if p.zoneSerials == nil {
+		p.zoneSerials = make(map[string]uint32)
+	}
+	last, seen := p.zoneSerials[fqdn]
+	previousRRs := p.zoneRRs[fqdn]
+	p.zoneSerials[fqdn] = soa.Serial
+	p.lock.Unlock()
+
+	if !seen || soa.Serial <= last {
+		p.snapshotZoneRRs(ctx, fqdn, zone)
+		return
+	}
+
+	log.Infof("zone %s serial bumped %d -> %d, notifying peers", fqdn, last, soa.Serial)
+	currentRRs := p.Redis.AXFR(ctx, zone, p.zones)
+	p.recordJournalEntry(ctx, fqdn, previousRRs, currentRRs, soa)
+	p.saveZoneRRs(fqdn, currentRRs)
+	p.notifyPeers(fqdn)
+}
+
+// snapshotZoneRRs records the zone's current RR set as the diff baseline if
+// none is held yet (normally the first time the zone is observed), so the
+// next bump has a baseline to diff against. An existing baseline is kept
+// as is until a serial bump replaces it.
+func (p *Plugin) snapshotZoneRRs(ctx context.Context, fqdn string, zone *record.Zone) {
+	p.lock.Lock()
+	_, have := p.zoneRRs[fqdn]
+	p.lock.Unlock()
+	if have {
+		return
+	}
+	p.saveZoneRRs(fqdn, p.Redis.AXFR(ctx, zone, p.zones))
+}
+
+func (p *Plugin) saveZoneRRs(fqdn string, rrs []dns.RR) {
+	p.lock.Lock()
+	if p.zoneRRs == nil {
+		p.zoneRRs = make(map[string][]dns.RR)
+	}
+	p.zoneRRs[fqdn] = rrs
+	p.lock.Unlock()
+}
+
+// recordJournalEntry diffs previous against current (both full AXFR-style RR
+// sets) and saves the result as the IXFR journal entry for newSOA.Serial.
+// A nil previous set (no baseline was captured, e.g. the snapshot's AXFR
+// returned nothing) has nothing to diff against, so no journal entry is
+// written - the next bump after that is the first one a client can
+// actually IXFR through.
+func (p *Plugin) recordJournalEntry(ctx context.Context, fqdn string, previous, current []dns.RR, newSOA *dns.SOA) {
+	if previous == nil {
+		return
+	}
+	oldSOA := findSOA(previous)
+	if oldSOA == nil {
+		return
+	}
+	add, remove := diffRRs(previous, current)
+	change := record.IXFRChange{OldSOA: oldSOA, NewSOA: newSOA, Add: add, Remove: remove}
+	if err := p.Redis.SaveIXFRJournal(ctx, fqdn, newSOA.Serial, change); err != nil {
+		log.Warningf("failed to save ixfr journal entry for zone %s serial %d: %v", fqdn, newSOA.Serial, err)
+	}
+}
+
+func findSOA(rrs []dns.RR) *dns.SOA {
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa
+		}
+	}
+	return nil
+}
+
+// diffRRs compares two full zone RR sets by presentation-format string and
+// returns the RRs added and removed going from previous to current. SOA
+// records are left out: the change's OldSOA/NewSOA carry them.
+func diffRRs(previous, current []dns.RR) (add, remove []dns.RR) {
+	prevSet := make(map[string]struct{}, len(previous))
+	for _, rr := range previous {
+		prevSet[rr.String()] = struct{}{}
+	}
+	curSet := make(map[string]struct{}, len(current))
+	for _, rr := range current {
+		curSet[rr.String()] = struct{}{}
+	}
+	for _, rr := range current {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			continue
+		}
+		if _, ok := prevSet[rr.String()]; !ok {
+			add = append(add, rr)
+		}
+	}
+	for _, rr := range previous {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			continue
+		}
+		if _, ok := curSet[rr.String()]; !ok {
+			remove = append(remove, rr)
+		}
+	}
+	return add, remove
+}
+
 func (p *Plugin) checkCache() {
 	if time.Now().Sub(p.lastRefresh).Seconds() > float64(p.Redis.DefaultTtl*2) {
 		p.startZoneNameCache()
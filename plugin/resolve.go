@@ -0,0 +1,168 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// maxResolveDepth caps how many CNAME hops the resolver will follow before
+// giving up, so a pathological chain can't hold a goroutine forever.
+const maxResolveDepth = 16
+
+// resolveKey identifies a (name, qtype) pair in the visited set used to
+// detect cycles while walking the CNAME/MX/NS/SRV resolution graph.
+type resolveKey struct {
+	name  string
+	qtype uint16
+}
+
+func (k resolveKey) String() string {
+	return k.name + "/" + qtypeLabel(k.qtype)
+}
+
+// resolver walks the CNAME/MX/NS/SRV resolution graph for a single query. It
+// prefers zones already loaded from Redis and only reaches out to the
+// configured upstream when no local zone owns a name. The walk is iterative
+// (a loop, not recursion) and a (name, qtype) pair is never enqueued twice,
+// so a self-referential chain in Redis can't recurse forever.
+type resolver struct {
+	p       *Plugin
+	ctx     context.Context
+	state   request.Request
+	visited map[resolveKey]struct{}
+
+	// step performs a single (name, qtype) hop; it's a field rather than a
+	// direct call to r.stepZone so tests can exercise resolve's depth cap
+	// and cycle detection deterministically, without a live Redis/upstream.
+	step func(name string, qtype uint16) (rrs, extras []dns.RR, result Result, cnameTarget string)
+}
+
+func newResolver(ctx context.Context, p *Plugin, state request.Request) *resolver {
+	r := &resolver{p: p, ctx: ctx, state: state, visited: make(map[resolveKey]struct{})}
+	r.step = r.stepZone
+	return r
+}
+
+// resolve answers (name, qtype), chasing CNAMEs found in Redis and falling
+// back to the upstream resolver, up to maxResolveDepth hops. The returned
+// extras are whatever the final hop's step contributed (e.g. NS/MX/SRV
+// glue) - intermediate CNAME hops never carry any.
+func (r *resolver) resolve(name string, qtype uint16) (answers, extras []dns.RR, result Result) {
+	cur := name
+	for depth := 0; depth < maxResolveDepth; depth++ {
+		key := resolveKey{name: cur, qtype: qtype}
+		if _, seen := r.visited[key]; seen {
+			log.Errorf("resolution cycle detected resolving %s %s (visited: %s)", name, qtypeLabel(qtype), r.visitedNames())
+			return answers, extras, ServerFailure
+		}
+		r.visited[key] = struct{}{}
+
+		rrs, hopExtras, hopResult, cname := r.step(cur, qtype)
+		answers = append(answers, rrs...)
+		if cname == "" {
+			return answers, hopExtras, hopResult
+		}
+		cur = cname
+	}
+	log.Errorf("resolution depth (%d) exceeded chasing %s %s", maxResolveDepth, name, qtypeLabel(qtype))
+	return answers, extras, ServerFailure
+}
+
+// stepZone resolves a single (name, qtype) hop: locally if a loaded zone
+// owns name, otherwise via the upstream resolver. If the local answer is
+// itself a CNAME and the caller wasn't asking for CNAME, the CNAME's target
+// is returned so resolve can keep chasing it.
+func (r *resolver) stepZone(name string, qtype uint16) (rrs, extras []dns.RR, result Result, cnameTarget string) {
+	if zoneName := plugin.Zones(r.p.zones).Matches(name); zoneName != "" {
+		if zone := r.p.loadZone(r.ctx, zoneName); zone != nil {
+			if location := r.p.Redis.FindLocation(r.ctx, name, zone); location != "" {
+				zoneRecords := r.p.loadZoneRecords(r.ctx, zone, location, qtype)
+				zoneRecords.MakeFqdn(zone.Name)
+
+				if qtype != dns.TypeCNAME && len(zoneRecords.CNAME) > 0 {
+					answers, _ := r.p.Redis.CNAME(name, zone, zoneRecords)
+					if len(answers) > 0 {
+						return answers, nil, Success, answers[0].(*dns.CNAME).Target
+					}
+				}
+
+				answers, extras, _ := r.p.buildAnswer(r.ctx, zone, zoneRecords, name, qtype)
+				if qtype == dns.TypeNS || qtype == dns.TypeMX || qtype == dns.TypeSRV {
+					extras = r.p.fillGlue(r.ctx, r.state, answers, extras)
+				}
+				return answers, extras, Success, ""
+			}
+			return nil, nil, NameError, ""
+		}
+		return nil, nil, ServerFailure, ""
+	}
+
+	answers, result := r.p.externalLookup(r.ctx, r.state, name, qtype)
+	return answers, nil, result, ""
+}
+
+func (r *resolver) visitedNames() string {
+	names := make([]string, 0, len(r.visited))
+	for k := range r.visited {
+		names = append(names, k.String())
+	}
+	return strings.Join(names, " -> ")
+}
+
+// fillGlue resolves A/AAAA glue for every NS/MX/SRV target referenced by
+// answers that isn't already present in extras, using the same CNAME-aware,
+// cycle-safe engine as resolve. Unlike the single-zone lookups the
+// NS/MX/SRV builders do internally, this also falls back to the upstream
+// resolver for targets no local zone owns.
+func (p *Plugin) fillGlue(ctx context.Context, state request.Request, answers, extras []dns.RR) []dns.RR {
+	have := make(map[string]struct{}, len(extras))
+	for _, rr := range extras {
+		have[rr.Header().Name] = struct{}{}
+	}
+
+	for _, target := range glueTargets(answers) {
+		if _, ok := have[target]; ok {
+			continue
+		}
+		have[target] = struct{}{}
+		res := newResolver(ctx, p, state)
+		for _, qt := range [...]uint16{dns.TypeA, dns.TypeAAAA} {
+			if rrs, _, result := res.resolve(target, qt); result == Success {
+				extras = append(extras, rrs...)
+			}
+		}
+	}
+	return extras
+}
+
+// glueTargets extracts the names answers refer out to - NS.Ns, MX.Mx,
+// SRV.Target - in first-seen order.
+func glueTargets(answers []dns.RR) []string {
+	seen := make(map[string]struct{})
+	var targets []string
+	add := func(name string) {
+		if name == "" {
+			return
+		}
+		if _, ok := seen[name]; ok {
+			return
+		}
+		seen[name] = struct{}{}
+		targets = append(targets, name)
+	}
+	for _, rr := range answers {
+		switch v := rr.(type) {
+		case *dns.NS:
+			add(v.Ns)
+		case *dns.MX:
+			add(v.Mx)
+		case *dns.SRV:
+			add(v.Target)
+		}
+	}
+	return targets
+}
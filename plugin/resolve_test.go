@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+func newTestResolver() *resolver {
+	state := request.Request{Req: new(dns.Msg)}
+	return newResolver(context.Background(), &Plugin{}, state)
+}
+
+// TestResolveCycleDetection verifies a self-referential chain (a CNAME
+// pointing back to a name already on the walk) is rejected with
+// ServerFailure instead of looping forever.
+func TestResolveCycleDetection(t *testing.T) {
+	r := newTestResolver()
+	r.step = func(name string, qtype uint16) ([]dns.RR, []dns.RR, Result, string) {
+		switch name {
+		case "a.example.":
+			return nil, nil, Success, "b.example."
+		case "b.example.":
+			return nil, nil, Success, "a.example." // cycles back to the first hop
+		default:
+			t.Fatalf("unexpected step for %s", name)
+			return nil, nil, ServerFailure, ""
+		}
+	}
+
+	_, _, result := r.resolve("a.example.", dns.TypeA)
+	if result != ServerFailure {
+		t.Fatalf("resolve() on a cyclical chain = %v, want ServerFailure", result)
+	}
+}
+
+// TestResolveDepthCap verifies a long, non-cyclical CNAME chain is cut off
+// at maxResolveDepth rather than followed indefinitely.
+func TestResolveDepthCap(t *testing.T) {
+	r := newTestResolver()
+	hops := 0
+	r.step = func(name string, qtype uint16) ([]dns.RR, []dns.RR, Result, string) {
+		hops++
+		return nil, nil, Success, name + "x" // always a fresh name, never revisited
+	}
+
+	_, _, result := r.resolve("a.", dns.TypeA)
+	if result != ServerFailure {
+		t.Fatalf("resolve() past maxResolveDepth = %v, want ServerFailure", result)
+	}
+	if hops != maxResolveDepth {
+		t.Fatalf("resolve() took %d hops, want exactly maxResolveDepth (%d)", hops, maxResolveDepth)
+	}
+}
+
+// TestResolveStopsOnNonCNAME verifies a hop that doesn't return a further
+// CNAME target ends the walk successfully without visiting maxResolveDepth.
+func TestResolveStopsOnNonCNAME(t *testing.T) {
+	r := newTestResolver()
+	want := []dns.RR{&dns.A{}}
+	r.step = func(name string, qtype uint16) ([]dns.RR, []dns.RR, Result, string) {
+		if name != "a.example." {
+			t.Fatalf("unexpected step for %s", name)
+		}
+		return want, nil, Success, ""
+	}
+
+	rrs, _, result := r.resolve("a.example.", dns.TypeA)
+	if result != Success {
+		t.Fatalf("resolve() = %v, want Success", result)
+	}
+	if len(rrs) != len(want) {
+		t.Fatalf("resolve() returned %d RRs, want %d", len(rrs), len(want))
+	}
+}
@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
+	"github.com/miekg/dns"
+	redis "github.com/polymorpher/coredns-redis"
+)
+
+func init() {
+	plugin.Register(name, setup)
+}
+
+func setup(c *caddy.Controller) error {
+	p, err := parseRedis(c)
+	if err != nil {
+		return plugin.Error(name, err)
+	}
+
+	c.OnStartup(func() error {
+		p.loadZoneTicker = time.NewTicker(time.Duration(p.Redis.DefaultTtl) * time.Second)
+		p.startZoneNameCache()
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		p.Next = next
+		return p
+	})
+
+	return nil
+}
+
+// parseRedis reads the `redis` Corefile stanza into a *Plugin:
+//
+//	redis [zones...] {
+//	    redis_type standalone|sentinel|cluster
+//	    addresses  HOST:PORT...
+//	    address    HOST:PORT
+//	    master_name NAME
+//	    password   PASSWORD
+//	    db         N
+//	    key_prefix PREFIX
+//	    default_ttl SECONDS
+//	    cache_size N
+//	    cache_negative_ttl DURATION
+//	    keyspace_notifications yes|no
+//	    to         CIDR...
+//	    tsig       KEYNAME ALGORITHM SECRET
+//	    notify     HOST:PORT...
+//	    upstream
+//	}
+func parseRedis(c *caddy.Controller) (*Plugin, error) {
+	cfg := redis.Config{DefaultTtl: 300}
+	policy := &TransferPolicy{Tsig: map[string]*TsigKey{}}
+	p := &Plugin{Upstream: upstream.New(), TransferPolicy: policy}
+
+	for c.Next() {
+		for c.NextBlock() {
+			switch c.Val() {
+			case "redis_type":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				cfg.Type = redis.RedisType(c.Val())
+			case "addresses":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				cfg.Addresses = args
+			case "address":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				cfg.Addresses = []string{c.Val()}
+			case "master_name":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				cfg.MasterName = c.Val()
+			case "password":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				cfg.Password = c.Val()
+			case "db":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return nil, err
+				}
+				cfg.DB = n
+			case "key_prefix":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				cfg.KeyPrefix = c.Val()
+			case "default_ttl":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return nil, err
+				}
+				cfg.DefaultTtl = uint32(n)
+			case "cache_size":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return nil, err
+				}
+				p.CacheSize = n
+			case "cache_negative_ttl":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return nil, err
+				}
+				p.CacheNegative = d
+			case "keyspace_notifications":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				p.KeyspaceNotifications = c.Val() == "yes" || c.Val() == "true"
+			case "to":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, cidr := range args {
+					_, n, err := net.ParseCIDR(cidr)
+					if err != nil {
+						return nil, err
+					}
+					policy.To = append(policy.To, n)
+				}
+			case "tsig":
+				args := c.RemainingArgs()
+				if len(args) != 3 {
+					return nil, c.ArgErr()
+				}
+				policy.Tsig[dns.Fqdn(args[0])] = &TsigKey{Algorithm: args[1], Secret: args[2]}
+			case "notify":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				policy.NotifyTo = append(policy.NotifyTo, args...)
+			case "upstream":
+				// p.Upstream is always upstream.New(); any arguments are ignored.
+				c.RemainingArgs()
+			default:
+				return nil, c.ArgErr()
+			}
+		}
+	}
+
+	client, err := redis.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.Redis = client
+
+	if len(policy.Tsig) > 0 {
+		// The core DNS server verifies TSIG itself, against the original
+		// wire bytes, before our handler ever sees the request; it needs
+		// these secrets to do that. Request-time verification (see
+		// transferAllowed) only has to trust the result via
+		// state.W.TsigStatus(), never re-derive it from a re-packed *dns.Msg.
+		conf := dnsserver.GetConfig(c)
+		if conf.TsigSecret == nil {
+			conf.TsigSecret = map[string]string{}
+		}
+		for name, key := range policy.tsigSecrets() {
+			conf.TsigSecret[name] = key
+		}
+	}
+
+	return p, nil
+}
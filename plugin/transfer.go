@@ -0,0 +1,174 @@
+package plugin
+
+import (
+	"context"
+	"net"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/polymorpher/coredns-redis/record"
+)
+
+// TsigKey holds a single named TSIG key as configured by a `tsig` line in the
+// Corefile `redis` block.
+type TsigKey struct {
+	Algorithm string
+	Secret    string
+}
+
+// TransferPolicy gates AXFR/IXFR and outbound NOTIFY for the zones served by
+// the plugin. It is built once from the `to`, `tsig` and `notify` lines of
+// the Corefile `redis` block (there is no separate `transfer` block) and is
+// safe for concurrent reads from ServeDNS.
+type TransferPolicy struct {
+	To       []*net.IPNet
+	Tsig     map[string]*TsigKey // keyed by the TSIG key name (FQDN form)
+	NotifyTo []string            // peer addresses in host:port form
+}
+
+// allowedFrom reports whether remote is permitted to request a zone transfer.
+// An empty policy (no `to` CIDRs configured) denies everyone, matching the
+// secure-by-default posture the plugin ships with.
+func (tp *TransferPolicy) allowedFrom(remote net.IP) bool {
+	if tp == nil || remote == nil {
+		return false
+	}
+	for _, n := range tp.To {
+		if n.Contains(remote) {
+			return true
+		}
+	}
+	return false
+}
+
+// tsigSecrets returns the key-name -> base64-secret map dns.Transfer expects.
+func (tp *TransferPolicy) tsigSecrets() map[string]string {
+	if tp == nil {
+		return nil
+	}
+	secrets := make(map[string]string, len(tp.Tsig))
+	for name, key := range tp.Tsig {
+		secrets[name] = key.Secret
+	}
+	return secrets
+}
+
+// verifyTsig checks the TSIG attached to state's request against the
+// configured keys. The MAC itself was already verified by the core DNS
+// server against the original inbound wire bytes - that's the only place
+// the pre-parse bytes a client actually signed are still available, since
+// re-packing a parsed *dns.Msg doesn't reliably reproduce them (compression
+// and RR ordering can differ) - and the result is surfaced on the
+// ResponseWriter via TsigStatus. This only needs to additionally confirm
+// the key name the request claims is one we actually trust.
+func (tp *TransferPolicy) verifyTsig(state request.Request) bool {
+	if tp == nil || len(tp.Tsig) == 0 {
+		return false
+	}
+	t := state.Req.IsTsig()
+	if t == nil {
+		return false
+	}
+	if _, ok := tp.Tsig[t.Hdr.Name]; !ok {
+		return false
+	}
+	return state.W.TsigStatus() == nil
+}
+
+// transferAllowed applies the CIDR and TSIG checks for an inbound AXFR/IXFR
+// request, logging the reason for a rejection.
+func (p *Plugin) transferAllowed(state request.Request, r *dns.Msg) bool {
+	remote := net.ParseIP(state.IP())
+	if !p.TransferPolicy.allowedFrom(remote) {
+		log.Warningf("zone transfer refused: %s is not in an allowed transfer CIDR", state.IP())
+		return false
+	}
+	if !p.TransferPolicy.verifyTsig(state) {
+		log.Warningf("zone transfer refused: TSIG verification failed for %s", state.IP())
+		return false
+	}
+	return true
+}
+
+// notifyPeers sends a DNS NOTIFY for zone to every configured peer. Failures
+// are logged and otherwise ignored: secondaries fall back to their normal
+// refresh/retry timers if a NOTIFY is dropped.
+func (p *Plugin) notifyPeers(zone string) {
+	if p.TransferPolicy == nil || len(p.TransferPolicy.NotifyTo) == 0 {
+		return
+	}
+	peers := append([]string(nil), p.TransferPolicy.NotifyTo...)
+	go func() {
+		m := new(dns.Msg)
+		m.SetNotify(zone)
+		c := new(dns.Client)
+		for _, peer := range peers {
+			if _, _, err := c.Exchange(m, peer); err != nil {
+				log.Warningf("NOTIFY to %s for zone %s failed: %v", peer, zone, err)
+			}
+		}
+	}()
+}
+
+// handleIXFR answers an incremental zone transfer request using the journal
+// of per-serial changes stored in Redis as one sorted set per zone under
+// ixfr:<zone>, scored by each change's new serial (there is no separate
+// key per serial). If the
+// client is already at or ahead of the current serial, it gets a single-SOA
+// "up to date" answer per RFC 1995.
+func (p *Plugin) handleIXFR(ctx context.Context, zone *record.Zone, zoneRecords *record.Records, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{Req: r, W: w}
+	currentSOA, _ := p.Redis.SOA(zone, zoneRecords)
+	if len(currentSOA) == 0 {
+		return p.Redis.ErrorResponse(state, zone.Name, dns.RcodeServerFailure, nil)
+	}
+	soa, ok := currentSOA[0].(*dns.SOA)
+	if !ok {
+		return p.Redis.ErrorResponse(state, zone.Name, dns.RcodeServerFailure, nil)
+	}
+
+	clientSOA, ok := clientSerial(r)
+	if !ok || clientSOA >= soa.Serial {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{soa}
+		return dns.RcodeSuccess, w.WriteMsg(m)
+	}
+
+	journal, err := p.Redis.LoadIXFRJournal(ctx, zone.Name, clientSOA, soa.Serial)
+	if err != nil || len(journal) == 0 {
+		log.Warningf("no ixfr journal for zone %s from serial %d, falling back to AXFR", zone.Name, clientSOA)
+		return p.handleZoneTransfer(ctx, zone, p.zones, w, r)
+	}
+
+	envelope := []dns.RR{soa}
+	for _, change := range journal {
+		envelope = append(envelope, change.OldSOA)
+		envelope = append(envelope, change.Remove...)
+		envelope = append(envelope, change.NewSOA)
+		envelope = append(envelope, change.Add...)
+	}
+	envelope = append(envelope, soa)
+
+	ch := make(chan *dns.Envelope, 1)
+	go func() {
+		ch <- &dns.Envelope{RR: envelope}
+		close(ch)
+	}()
+	tr := new(dns.Transfer)
+	tr.TsigSecret = p.TransferPolicy.tsigSecrets()
+	if err := tr.Out(w, r, ch); err != nil {
+		log.Errorf("ixfr transfer to %s failed: %v", w.RemoteAddr(), err)
+	}
+	w.Hijack()
+	return dns.RcodeSuccess, nil
+}
+
+func clientSerial(r *dns.Msg) (uint32, bool) {
+	for _, rr := range r.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// fakeResponseWriter is a minimal dns.ResponseWriter whose TsigStatus and
+// RemoteAddr are whatever the test sets them to - standing in for the core
+// DNS server, which is the only place a TSIG MAC over the original wire
+// bytes can actually be verified.
+type fakeResponseWriter struct {
+	remote  net.IP
+	tsigErr error
+}
+
+func (f *fakeResponseWriter) LocalAddr() net.Addr       { return &net.IPAddr{IP: net.IPv4zero} }
+func (f *fakeResponseWriter) RemoteAddr() net.Addr      { return &net.IPAddr{IP: f.remote} }
+func (f *fakeResponseWriter) WriteMsg(*dns.Msg) error   { return nil }
+func (f *fakeResponseWriter) Write([]byte) (int, error) { return 0, nil }
+func (f *fakeResponseWriter) Close() error              { return nil }
+func (f *fakeResponseWriter) TsigStatus() error         { return f.tsigErr }
+func (f *fakeResponseWriter) TsigTimersOnly(bool)       {}
+func (f *fakeResponseWriter) Hijack()                   {}
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatalf("ParseCIDR(%q): %v", s, err)
+	}
+	return n
+}
+
+func TestTransferPolicyAllowedFrom(t *testing.T) {
+	tp := &TransferPolicy{To: []*net.IPNet{mustCIDR(t, "10.0.0.0/8")}}
+
+	cases := []struct {
+		name string
+		ip   net.IP
+		want bool
+	}{
+		{"in range", net.ParseIP("10.1.2.3"), true},
+		{"out of range", net.ParseIP("192.168.1.1"), false},
+		{"nil remote", nil, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := tp.allowedFrom(c.ip); got != c.want {
+				t.Errorf("allowedFrom(%v) = %v, want %v", c.ip, got, c.want)
+			}
+		})
+	}
+
+	if (*TransferPolicy)(nil).allowedFrom(net.ParseIP("10.1.2.3")) {
+		t.Error("nil policy should deny everyone")
+	}
+	if (&TransferPolicy{}).allowedFrom(net.ParseIP("10.1.2.3")) {
+		t.Error("policy with no `to` CIDRs should deny everyone")
+	}
+}
+
+func TestTransferPolicyVerifyTsig(t *testing.T) {
+	keyName := dns.Fqdn("axfr-key")
+	tp := &TransferPolicy{Tsig: map[string]*TsigKey{
+		keyName: {Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"},
+	}}
+
+	signedMsg := func() *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeAXFR)
+		m.SetTsig(keyName, dns.HmacSHA256, 300, 0)
+		return m
+	}
+	unconfiguredKeyMsg := func() *dns.Msg {
+		m := new(dns.Msg)
+		m.SetTsig("other-key.", dns.HmacSHA256, 300, 0)
+		return m
+	}
+
+	cases := []struct {
+		name    string
+		req     *dns.Msg
+		tsigErr error
+		want    bool
+	}{
+		{"verified and trusted key", signedMsg(), nil, true},
+		{"server rejected the MAC", signedMsg(), dns.ErrSig, false},
+		{"no TSIG on request", new(dns.Msg), nil, false},
+		{"unconfigured key name", unconfiguredKeyMsg(), nil, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := request.Request{Req: c.req, W: &fakeResponseWriter{tsigErr: c.tsigErr}}
+			if got := tp.verifyTsig(state); got != c.want {
+				t.Errorf("verifyTsig() = %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	if (*TransferPolicy)(nil).verifyTsig(request.Request{Req: signedMsg(), W: &fakeResponseWriter{}}) {
+		t.Error("nil policy should refuse transfer rather than allow unsigned requests")
+	}
+}
+
+func TestTransferAllowed(t *testing.T) {
+	keyName := dns.Fqdn("axfr-key")
+	p := &Plugin{TransferPolicy: &TransferPolicy{
+		To:   []*net.IPNet{mustCIDR(t, "10.0.0.0/8")},
+		Tsig: map[string]*TsigKey{keyName: {Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}},
+	}}
+
+	signed := new(dns.Msg)
+	signed.SetTsig(keyName, dns.HmacSHA256, 300, 0)
+
+	if ok := p.transferAllowed(request.Request{
+		Req: signed,
+		W:   &fakeResponseWriter{remote: net.ParseIP("10.1.2.3")},
+	}, signed); !ok {
+		t.Error("transferAllowed() = false for an in-CIDR, correctly TSIG'd request, want true")
+	}
+
+	if ok := p.transferAllowed(request.Request{
+		Req: signed,
+		W:   &fakeResponseWriter{remote: net.ParseIP("192.168.1.1")},
+	}, signed); ok {
+		t.Error("transferAllowed() = true for an out-of-CIDR request, want false")
+	}
+}
@@ -0,0 +1,13 @@
+package record
+
+import "github.com/miekg/dns"
+
+// IXFRChange is one serial-to-serial delta in a zone's IXFR journal: the old
+// and new SOA bracketing the change, and the RRs removed and added between
+// them, per RFC 1995's "old SOA, deletions, new SOA, additions" framing.
+type IXFRChange struct {
+	OldSOA *dns.SOA
+	NewSOA *dns.SOA
+	Remove []dns.RR
+	Add    []dns.RR
+}
@@ -0,0 +1,176 @@
+package record
+
+import "strings"
+
+// Zone identifies a zone apex loaded from Redis. Records are looked up
+// underneath it by location (see Records).
+type Zone struct {
+	Name string
+}
+
+// A is a single IPv4 address record.
+type A struct {
+	Ip  string `json:"ip"`
+	Ttl uint32 `json:"ttl,omitempty"`
+}
+
+// AAAA is a single IPv6 address record.
+type AAAA struct {
+	Ip  string `json:"ip"`
+	Ttl uint32 `json:"ttl,omitempty"`
+}
+
+// CNAME is a single canonical-name record.
+type CNAME struct {
+	Host string `json:"host"`
+	Ttl  uint32 `json:"ttl,omitempty"`
+}
+
+// TXT is a single free-text record.
+type TXT struct {
+	Text string `json:"text"`
+	Ttl  uint32 `json:"ttl,omitempty"`
+}
+
+// NS is a single authoritative-nameserver record.
+type NS struct {
+	Host string `json:"host"`
+	Ttl  uint32 `json:"ttl,omitempty"`
+}
+
+// MX is a single mail-exchanger record.
+type MX struct {
+	Host       string `json:"host"`
+	Preference uint16 `json:"preference"`
+	Ttl        uint32 `json:"ttl,omitempty"`
+}
+
+// SRV is a single service record.
+type SRV struct {
+	Target   string `json:"target"`
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Port     uint16 `json:"port"`
+	Ttl      uint32 `json:"ttl,omitempty"`
+}
+
+// PTR is a single reverse-lookup record.
+type PTR struct {
+	Name string `json:"name"`
+	Ttl  uint32 `json:"ttl,omitempty"`
+}
+
+// CAA is a single certification-authority-authorization record.
+type CAA struct {
+	Flag  uint8  `json:"flag"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+	Ttl   uint32 `json:"ttl,omitempty"`
+}
+
+// SOA is the start-of-authority record for a zone apex.
+type SOA struct {
+	Ns      string `json:"ns"`
+	MBox    string `json:"mbox"`
+	Serial  uint32 `json:"serial"`
+	Refresh uint32 `json:"refresh"`
+	Retry   uint32 `json:"retry"`
+	Expire  uint32 `json:"expire"`
+	MinTtl  uint32 `json:"minttl"`
+	Ttl     uint32 `json:"ttl,omitempty"`
+}
+
+// Records is the decoded JSON document stored at a single (zone, location)
+// hash field in Redis. A location usually populates only one or two of
+// these slices.
+type Records struct {
+	A     []A     `json:"a,omitempty"`
+	AAAA  []AAAA  `json:"aaaa,omitempty"`
+	CNAME []CNAME `json:"cname,omitempty"`
+	TXT   []TXT   `json:"txt,omitempty"`
+	NS    []NS    `json:"ns,omitempty"`
+	MX    []MX    `json:"mx,omitempty"`
+	SRV   []SRV   `json:"srv,omitempty"`
+	PTR   []PTR   `json:"ptr,omitempty"`
+	CAA   []CAA   `json:"caa,omitempty"`
+	SOA   []SOA   `json:"soa,omitempty"`
+
+	name string
+}
+
+// MakeFqdn records the owner name (zone apex, dotted form) these records
+// were loaded for, so the SOA builder in the root package can stamp it onto
+// the SOA header without it being threaded through the call; the other RR
+// builders take their owner name as a parameter.
+func (r *Records) MakeFqdn(zone string) {
+	if r == nil {
+		return
+	}
+	if !strings.HasSuffix(zone, ".") {
+		zone += "."
+	}
+	r.name = zone
+}
+
+// Name returns the owner name set by MakeFqdn.
+func (r *Records) Name() string {
+	if r == nil {
+		return ""
+	}
+	return r.name
+}
+
+// MinTTL returns the smallest TTL among all records present, and whether
+// any record was present at all. A location with no records reports
+// ok=false so the caller can fall back to a negative-cache TTL instead.
+// A record's zero/omitted Ttl means "use the zone default" (see
+// ttlOrDefault in rr.go), not literally zero, so defaultTtl is folded in
+// before comparing - otherwise a record relying on the default would make
+// the whole location expire from the cache immediately.
+func (r *Records) MinTTL(defaultTtl uint32) (uint32, bool) {
+	if r == nil {
+		return 0, false
+	}
+	var min uint32
+	ok := false
+	consider := func(ttl uint32) {
+		if ttl == 0 {
+			ttl = defaultTtl
+		}
+		if !ok || ttl < min {
+			min = ttl
+			ok = true
+		}
+	}
+	for _, x := range r.A {
+		consider(x.Ttl)
+	}
+	for _, x := range r.AAAA {
+		consider(x.Ttl)
+	}
+	for _, x := range r.CNAME {
+		consider(x.Ttl)
+	}
+	for _, x := range r.TXT {
+		consider(x.Ttl)
+	}
+	for _, x := range r.NS {
+		consider(x.Ttl)
+	}
+	for _, x := range r.MX {
+		consider(x.Ttl)
+	}
+	for _, x := range r.SRV {
+		consider(x.Ttl)
+	}
+	for _, x := range r.PTR {
+		consider(x.Ttl)
+	}
+	for _, x := range r.CAA {
+		consider(x.Ttl)
+	}
+	for _, x := range r.SOA {
+		consider(x.Ttl)
+	}
+	return min, ok
+}
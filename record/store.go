@@ -0,0 +1,139 @@
+package record
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// Backend is the subset of *redis.Redis a Store needs to fall through to on
+// a cache miss. It is declared here, rather than importing the root redis
+// package directly, to avoid an import cycle (the root package already
+// depends on record for Zone/Records).
+type Backend interface {
+	LoadZoneC(ctx context.Context, name string, noCache bool) *Zone
+	LoadZoneRecordsC(ctx context.Context, location string, zone *Zone) *Records
+}
+
+// Store fronts a Backend with an in-process cache so that repeated lookups
+// for hot names don't round-trip to Redis.
+type Store interface {
+	GetZone(ctx context.Context, name string) *Zone
+	GetLocation(ctx context.Context, zone *Zone, location string, qtype uint16) *Records
+	InvalidateZone(name string)
+	InvalidateLocation(zone, location string)
+}
+
+type cacheKey struct {
+	zone     string
+	location string
+	qtype    uint16
+}
+
+type cacheEntry struct {
+	records *Records
+	expires time.Time
+}
+
+// LayeredStore is a Store backed by a size-bounded LRU in front of Backend.
+// Entries are cached per (zone, location, qtype) and honor Records.MinTTL,
+// falling back to negativeTTL when a location has no records so repeated
+// NXDOMAIN-shaped queries don't hammer Redis.
+type LayeredStore struct {
+	backend     Backend
+	cache       *lru.Cache[cacheKey, cacheEntry]
+	negativeTTL time.Duration
+	defaultTTL  uint32
+
+	mu     sync.Mutex
+	byZone map[string]map[cacheKey]struct{}
+}
+
+// NewLayeredStore builds a LayeredStore with an LRU of the given size, the
+// given negative-cache TTL (used when a location has no records), and the
+// zone default TTL records fall back to when they don't set their own (see
+// Records.MinTTL).
+func NewLayeredStore(backend Backend, size int, negativeTTL time.Duration, defaultTTL uint32) (*LayeredStore, error) {
+	c, err := lru.New[cacheKey, cacheEntry](size)
+	if err != nil {
+		return nil, err
+	}
+	return &LayeredStore{
+		backend:     backend,
+		cache:       c,
+		negativeTTL: negativeTTL,
+		defaultTTL:  defaultTTL,
+		byZone:      make(map[string]map[cacheKey]struct{}),
+	}, nil
+}
+
+// GetZone is a pass-through to the backend; zone metadata is already kept
+// warm by the plugin's zone-name cache, so it isn't duplicated here.
+func (s *LayeredStore) GetZone(ctx context.Context, name string) *Zone {
+	return s.backend.LoadZoneC(ctx, name, false)
+}
+
+// GetLocation returns the decoded records for (zone, location, qtype),
+// serving from the LRU when possible and falling back to the backend on a
+// miss or expiry.
+func (s *LayeredStore) GetLocation(ctx context.Context, zone *Zone, location string, qtype uint16) *Records {
+	key := cacheKey{zone: zone.Name, location: location, qtype: qtype}
+
+	if e, ok := s.cache.Get(key); ok && time.Now().Before(e.expires) {
+		return e.records
+	}
+
+	records := s.backend.LoadZoneRecordsC(ctx, location, zone)
+	s.put(key, records)
+	return records
+}
+
+func (s *LayeredStore) put(key cacheKey, records *Records) {
+	ttl := s.negativeTTL
+	if min, ok := records.MinTTL(s.defaultTTL); ok {
+		ttl = time.Duration(min) * time.Second
+	}
+	s.cache.Add(key, cacheEntry{records: records, expires: time.Now().Add(ttl)})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set, ok := s.byZone[key.zone]
+	if !ok {
+		set = make(map[cacheKey]struct{})
+		s.byZone[key.zone] = set
+	}
+	set[key] = struct{}{}
+}
+
+// InvalidateZone drops every cached entry for zone, e.g. after a keyspace
+// notification reports the zone changed.
+func (s *LayeredStore) InvalidateZone(zone string) {
+	s.mu.Lock()
+	keys := s.byZone[zone]
+	delete(s.byZone, zone)
+	s.mu.Unlock()
+
+	for key := range keys {
+		s.cache.Remove(key)
+	}
+}
+
+// InvalidateLocation drops every cached qtype entry for (zone, location).
+func (s *LayeredStore) InvalidateLocation(zone, location string) {
+	s.mu.Lock()
+	keys := s.byZone[zone]
+	var drop []cacheKey
+	for key := range keys {
+		if key.location == location {
+			drop = append(drop, key)
+			delete(keys, key)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, key := range drop {
+		s.cache.Remove(key)
+	}
+}
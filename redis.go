@@ -0,0 +1,277 @@
+// Package redis is the low-level Redis client the plugin package talks to:
+// connection setup (standalone, Sentinel or Cluster, via go-redis/v8's
+// UniversalClient), zone/record decoding, AXFR/IXFR assembly and the
+// keyspace-notification subscription used for cache invalidation.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/miekg/dns"
+	"github.com/polymorpher/coredns-redis/record"
+)
+
+var log = clog.NewWithPlugin("redis")
+
+// RedisType selects which go-redis client UniversalClient builds.
+type RedisType string
+
+const (
+	TypeStandalone RedisType = "standalone"
+	TypeSentinel   RedisType = "sentinel"
+	TypeCluster    RedisType = "cluster"
+)
+
+// MaxTransferLength is the approximate per-envelope byte budget AXFR/IXFR
+// chunk RRs into, matching the old redigo client's behavior.
+const MaxTransferLength = 60000
+
+// defaultKeyPrefix is the key prefix used when the Corefile sets no
+// key_prefix: none, so zone hash keys are the bare zone names.
+const defaultKeyPrefix = ""
+
+// Config is built from the Corefile `redis` stanza by plugin.setup and
+// passed to New.
+type Config struct {
+	// Type selects standalone/sentinel/cluster. Defaults to TypeStandalone
+	// when empty, which also accepts a pre-existing single `Addresses`
+	// entry for backward compatibility with the old `address`/`password`
+	// Corefile options.
+	Type RedisType
+	// Addresses is one `host:port` for standalone, the list of sentinel
+	// addresses for TypeSentinel, or the seed nodes for TypeCluster.
+	Addresses  []string
+	MasterName string // required for TypeSentinel
+	Password   string
+	DB         int // ignored for TypeCluster, which is keyspace-per-node
+
+	KeyPrefix  string
+	DefaultTtl uint32
+}
+
+// Redis wraps a go-redis UniversalClient, which transparently talks to a
+// single node, a Sentinel-managed failover group, or a Cluster depending on
+// how it was constructed - the rest of this package never needs to know
+// which.
+type Redis struct {
+	Client     goredis.UniversalClient
+	KeyPrefix  string
+	DefaultTtl uint32
+}
+
+// New builds a Redis client from cfg, choosing the standalone, Sentinel or
+// Cluster go-redis client underneath a single UniversalClient handle.
+func New(cfg Config) (*Redis, error) {
+	addrs := cfg.Addresses
+	if len(addrs) == 0 {
+		addrs = []string{"127.0.0.1:6379"}
+	}
+
+	opts := &goredis.UniversalOptions{
+		Addrs:      addrs,
+		Password:   cfg.Password,
+		DB:         cfg.DB,
+		MasterName: cfg.MasterName,
+	}
+
+	switch cfg.Type {
+	case "", TypeStandalone:
+		if len(addrs) > 1 {
+			return nil, fmt.Errorf("redis_type standalone takes exactly one address, got %d", len(addrs))
+		}
+	case TypeSentinel:
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("redis_type sentinel requires master_name")
+		}
+	case TypeCluster:
+		opts.DB = 0
+	default:
+		return nil, fmt.Errorf("unknown redis_type %q", cfg.Type)
+	}
+
+	keyPrefix := cfg.KeyPrefix
+	if keyPrefix == "" {
+		keyPrefix = defaultKeyPrefix
+	}
+
+	return &Redis{
+		Client:     goredis.NewUniversalClient(opts),
+		KeyPrefix:  keyPrefix,
+		DefaultTtl: cfg.DefaultTtl,
+	}, nil
+}
+
+// NewFromLegacyOptions adapts the pre-go-redis Corefile options (a single
+// `address`/`password`/`db`, no redis_type) onto New, so existing Corefiles
+// that predate Cluster/Sentinel support keep working unchanged.
+func NewFromLegacyOptions(address, password string, db int, defaultTtl uint32) (*Redis, error) {
+	return New(Config{
+		Type:       TypeStandalone,
+		Addresses:  []string{address},
+		Password:   password,
+		DB:         db,
+		DefaultTtl: defaultTtl,
+	})
+}
+
+// Ping reports whether Redis is reachable.
+func (r *Redis) Ping(ctx context.Context) (bool, error) {
+	if err := r.Client.Ping(ctx).Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *Redis) zoneKey(zone string) string {
+	return r.KeyPrefix + strings.TrimSuffix(zone, ".")
+}
+
+// LoadAllZoneNames lists every zone apex this Redis instance holds.
+func (r *Redis) LoadAllZoneNames() ([]string, error) {
+	ctx := context.Background()
+	keys, err := r.Client.Keys(ctx, r.KeyPrefix+"*").Result()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if strings.HasPrefix(k, r.journalKey("")) {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(k, r.KeyPrefix)+".")
+	}
+	return names, nil
+}
+
+// CheckZoneName reports whether fqdn has a zone hash in Redis.
+func (r *Redis) CheckZoneName(fqdn string) (bool, error) {
+	n, err := r.Client.Exists(context.Background(), r.zoneKey(fqdn)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// LoadZoneC loads zone metadata for name. noCache is accepted for interface
+// parity with record.Backend; there is no longer a client-side zone cache to
+// bypass at this layer (the plugin's layered LRU in front of this backend
+// already owns that decision).
+func (r *Redis) LoadZoneC(ctx context.Context, name string, noCache bool) *record.Zone {
+	exists, err := r.Client.Exists(ctx, r.zoneKey(name)).Result()
+	if err != nil || exists == 0 {
+		return nil
+	}
+	return &record.Zone{Name: name}
+}
+
+// FindLocation returns the hash field within zone's key that owns qname:
+// "@" for the apex, the label(s) relative to the zone for anything else, or
+// "" if qname isn't served by zone (falling back to a wildcard "*" location
+// when the exact one is absent).
+func (r *Redis) FindLocation(ctx context.Context, qname string, zone *record.Zone) string {
+	if qname == zone.Name {
+		return "@"
+	}
+	location := strings.TrimSuffix(strings.TrimSuffix(qname, zone.Name), ".")
+	if location == "" {
+		return "@"
+	}
+
+	ctx2 := ctx
+	exists, err := r.Client.HExists(ctx2, r.zoneKey(zone.Name), location).Result()
+	if err == nil && exists {
+		return location
+	}
+	if exists, err := r.Client.HExists(ctx2, r.zoneKey(zone.Name), "*").Result(); err == nil && exists {
+		return "*"
+	}
+	return ""
+}
+
+// LoadZoneRecordsC loads the decoded records at location within zone. It
+// pipelines the apex ("@") fetch alongside the requested location into a
+// single Redis round trip, and copies the apex SOA into the result when the
+// location carries no SOA of its own. A location that is missing or fails
+// to decode yields empty Records, without the apex SOA.
+func (r *Redis) LoadZoneRecordsC(ctx context.Context, location string, zone *record.Zone) *record.Records {
+	key := r.zoneKey(zone.Name)
+
+	pipe := r.Client.Pipeline()
+	apexCmd := pipe.HGet(ctx, key, "@")
+	var locCmd *goredis.StringCmd
+	if location != "@" {
+		locCmd = pipe.HGet(ctx, key, location)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != goredis.Nil {
+		log.Errorf("failed to load records for %s in zone %s: %v", location, zone.Name, err)
+		return &record.Records{}
+	}
+
+	var apex record.Records
+	_ = json.Unmarshal([]byte(apexCmd.Val()), &apex)
+	if locCmd == nil {
+		return &apex
+	}
+
+	var records record.Records
+	if err := json.Unmarshal([]byte(locCmd.Val()), &records); err != nil {
+		return &record.Records{}
+	}
+	if len(records.SOA) == 0 {
+		records.SOA = apex.SOA
+	}
+	return &records
+}
+
+// AXFR assembles every RR owned by zone - the SOA first and last, per
+// convention, with every other location's records in between - ready to be
+// chunked into transfer envelopes by the caller.
+func (r *Redis) AXFR(ctx context.Context, zone *record.Zone, zones []string) []dns.RR {
+	key := r.zoneKey(zone.Name)
+	locations, err := r.Client.HKeys(ctx, key).Result()
+	if err != nil {
+		log.Errorf("failed to list locations for zone %s: %v", zone.Name, err)
+		return nil
+	}
+
+	apexRecords := r.LoadZoneRecordsC(ctx, "@", zone)
+	apexRecords.MakeFqdn(zone.Name)
+	soaAnswers, _ := r.SOA(zone, apexRecords)
+	if len(soaAnswers) == 0 {
+		return nil
+	}
+
+	rrs := make([]dns.RR, 0, len(locations)*2+2)
+	rrs = append(rrs, soaAnswers...)
+	rrs = append(rrs, r.recordsToRRs(ctx, zone.Name, apexRecords, zones)...)
+
+	for _, location := range locations {
+		if location == "@" {
+			continue
+		}
+		records := r.LoadZoneRecordsC(ctx, location, zone)
+		records.MakeFqdn(zone.Name)
+		fqdn := location + "." + zone.Name
+		rrs = append(rrs, r.recordsToRRs(ctx, fqdn, records, zones)...)
+	}
+
+	rrs = append(rrs, soaAnswers...)
+	return rrs
+}
+
+// ErrorResponse writes rcode as the reply to state's request and returns it
+// alongside err, matching the (int, error) plugin.Handler convention.
+func (r *Redis) ErrorResponse(state request.Request, zone string, rcode int, err error) (int, error) {
+	m := new(dns.Msg)
+	m.SetRcode(state.Req, rcode)
+	m.Authoritative = true
+	state.SizeAndDo(m)
+	_ = state.W.WriteMsg(m)
+	return rcode, err
+}
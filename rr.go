@@ -0,0 +1,253 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/polymorpher/coredns-redis/record"
+)
+
+func ttlOrDefault(ttl uint32, def uint32) uint32 {
+	if ttl > 0 {
+		return ttl
+	}
+	return def
+}
+
+func header(name string, rrtype uint16, ttl uint32) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+}
+
+// SOA builds the zone's SOA answer from its apex records. It always returns
+// exactly one RR (or none, if the apex has no SOA configured).
+func (r *Redis) SOA(zone *record.Zone, records *record.Records) (answers, extras []dns.RR) {
+	if len(records.SOA) == 0 {
+		return nil, nil
+	}
+	s := records.SOA[0]
+	soa := &dns.SOA{
+		Hdr:     header(records.Name(), dns.TypeSOA, ttlOrDefault(s.Ttl, r.DefaultTtl)),
+		Ns:      dns.Fqdn(s.Ns),
+		Mbox:    dns.Fqdn(s.MBox),
+		Serial:  s.Serial,
+		Refresh: s.Refresh,
+		Retry:   s.Retry,
+		Expire:  s.Expire,
+		Minttl:  s.MinTtl,
+	}
+	return []dns.RR{soa}, nil
+}
+
+// A builds A answers for qname from records.
+func (r *Redis) A(qname string, zone *record.Zone, records *record.Records) (answers, extras []dns.RR) {
+	for _, a := range records.A {
+		ip := net.ParseIP(a.Ip)
+		if ip == nil {
+			continue
+		}
+		answers = append(answers, &dns.A{
+			Hdr: header(qname, dns.TypeA, ttlOrDefault(a.Ttl, r.DefaultTtl)),
+			A:   ip,
+		})
+	}
+	return answers, nil
+}
+
+// AAAA builds AAAA answers for qname from records.
+func (r *Redis) AAAA(qname string, zone *record.Zone, records *record.Records) (answers, extras []dns.RR) {
+	for _, a := range records.AAAA {
+		ip := net.ParseIP(a.Ip)
+		if ip == nil {
+			continue
+		}
+		answers = append(answers, &dns.AAAA{
+			Hdr:  header(qname, dns.TypeAAAA, ttlOrDefault(a.Ttl, r.DefaultTtl)),
+			AAAA: ip,
+		})
+	}
+	return answers, nil
+}
+
+// CNAME builds the (at most one, per RFC 1034 §3.6.2) CNAME answer for
+// qname from records.
+func (r *Redis) CNAME(qname string, zone *record.Zone, records *record.Records) (answers, extras []dns.RR) {
+	if len(records.CNAME) == 0 {
+		return nil, nil
+	}
+	c := records.CNAME[0]
+	answers = append(answers, &dns.CNAME{
+		Hdr:    header(qname, dns.TypeCNAME, ttlOrDefault(c.Ttl, r.DefaultTtl)),
+		Target: dns.Fqdn(c.Host),
+	})
+	return answers, nil
+}
+
+// TXT builds TXT answers for qname from records.
+func (r *Redis) TXT(qname string, zone *record.Zone, records *record.Records) (answers, extras []dns.RR) {
+	for _, t := range records.TXT {
+		answers = append(answers, &dns.TXT{
+			Hdr: header(qname, dns.TypeTXT, ttlOrDefault(t.Ttl, r.DefaultTtl)),
+			Txt: splitTXT(t.Text),
+		})
+	}
+	return answers, nil
+}
+
+// splitTXT chunks s into <=255 byte segments, the max a single TXT
+// character-string can hold.
+func splitTXT(s string) []string {
+	const max = 255
+	if len(s) <= max {
+		return []string{s}
+	}
+	var parts []string
+	for len(s) > max {
+		parts = append(parts, s[:max])
+		s = s[max:]
+	}
+	return append(parts, s)
+}
+
+// NS builds NS answers for qname from records, plus best-effort A/AAAA glue
+// for any target already hosted in one of zones. This is a single,
+// non-recursive Redis lookup per target - it never chases CNAMEs and can't
+// cycle - so plugin.fillGlue layering additional (upstream-aware) glue on
+// top never duplicates unsafe work.
+func (r *Redis) NS(ctx context.Context, qname string, zone *record.Zone, records *record.Records, zones []string) (answers, extras []dns.RR) {
+	for _, n := range records.NS {
+		target := dns.Fqdn(n.Host)
+		answers = append(answers, &dns.NS{
+			Hdr: header(qname, dns.TypeNS, ttlOrDefault(n.Ttl, r.DefaultTtl)),
+			Ns:  target,
+		})
+		extras = append(extras, r.glueFor(ctx, target, zones)...)
+	}
+	return answers, extras
+}
+
+// MX builds MX answers for qname from records, plus best-effort glue (see NS).
+func (r *Redis) MX(ctx context.Context, qname string, zone *record.Zone, records *record.Records, zones []string) (answers, extras []dns.RR) {
+	for _, mx := range records.MX {
+		target := dns.Fqdn(mx.Host)
+		answers = append(answers, &dns.MX{
+			Hdr:        header(qname, dns.TypeMX, ttlOrDefault(mx.Ttl, r.DefaultTtl)),
+			Preference: mx.Preference,
+			Mx:         target,
+		})
+		extras = append(extras, r.glueFor(ctx, target, zones)...)
+	}
+	return answers, extras
+}
+
+// SRV builds SRV answers for qname from records, plus best-effort glue (see NS).
+func (r *Redis) SRV(ctx context.Context, qname string, zone *record.Zone, records *record.Records, zones []string) (answers, extras []dns.RR) {
+	for _, srv := range records.SRV {
+		target := dns.Fqdn(srv.Target)
+		answers = append(answers, &dns.SRV{
+			Hdr:      header(qname, dns.TypeSRV, ttlOrDefault(srv.Ttl, r.DefaultTtl)),
+			Priority: srv.Priority,
+			Weight:   srv.Weight,
+			Port:     srv.Port,
+			Target:   target,
+		})
+		extras = append(extras, r.glueFor(ctx, target, zones)...)
+	}
+	return answers, extras
+}
+
+// PTR builds PTR answers for qname from records.
+func (r *Redis) PTR(ctx context.Context, qname string, zone *record.Zone, records *record.Records, zones []string) (answers, extras []dns.RR) {
+	for _, p := range records.PTR {
+		answers = append(answers, &dns.PTR{
+			Hdr: header(qname, dns.TypePTR, ttlOrDefault(p.Ttl, r.DefaultTtl)),
+			Ptr: dns.Fqdn(p.Name),
+		})
+	}
+	return answers, nil
+}
+
+// CAA builds CAA answers for qname from records.
+func (r *Redis) CAA(qname string, zone *record.Zone, records *record.Records) (answers, extras []dns.RR) {
+	for _, c := range records.CAA {
+		answers = append(answers, &dns.CAA{
+			Hdr:   header(qname, dns.TypeCAA, ttlOrDefault(c.Ttl, r.DefaultTtl)),
+			Flag:  c.Flag,
+			Tag:   c.Tag,
+			Value: c.Value,
+		})
+	}
+	return answers, nil
+}
+
+// glueFor does a single non-recursive lookup of target within zones,
+// returning its A/AAAA records as glue. It returns nothing if target isn't
+// owned by any zone in zones - the caller (or plugin.fillGlue) is
+// responsible for falling further back to the upstream resolver.
+func (r *Redis) glueFor(ctx context.Context, target string, zones []string) []dns.RR {
+	zoneName := matchZone(target, zones)
+	if zoneName == "" {
+		return nil
+	}
+	zone := r.LoadZoneC(ctx, zoneName, false)
+	if zone == nil {
+		return nil
+	}
+	location := r.FindLocation(ctx, target, zone)
+	if location == "" {
+		return nil
+	}
+	records := r.LoadZoneRecordsC(ctx, location, zone)
+	records.MakeFqdn(zone.Name)
+
+	var glue []dns.RR
+	a, _ := r.A(target, zone, records)
+	aaaa, _ := r.AAAA(target, zone, records)
+	glue = append(glue, a...)
+	glue = append(glue, aaaa...)
+	return glue
+}
+
+// matchZone returns the longest zone in zones that is name or an ancestor
+// of it, or "" if none matches.
+func matchZone(name string, zones []string) string {
+	best := ""
+	for _, z := range zones {
+		if name == z || strings.HasSuffix(name, "."+z) {
+			if len(z) > len(best) {
+				best = z
+			}
+		}
+	}
+	return best
+}
+
+// recordsToRRs converts every record type present in records, owned by
+// fqdn, into RRs - used by AXFR to serialize a whole location at once by
+// running each of the qtype-specific builders above. It deliberately
+// skips glue (the NS/MX/SRV builders' extras): AXFR already walks every
+// location, so any in-zone glue target is serialized on its own when its
+// turn comes, and out-of-zone glue has no place in the transfer anyway.
+func (r *Redis) recordsToRRs(ctx context.Context, fqdn string, records *record.Records, zones []string) []dns.RR {
+	var rrs []dns.RR
+	a, _ := r.A(fqdn, nil, records)
+	aaaa, _ := r.AAAA(fqdn, nil, records)
+	cname, _ := r.CNAME(fqdn, nil, records)
+	txt, _ := r.TXT(fqdn, nil, records)
+	caa, _ := r.CAA(fqdn, nil, records)
+	ptr, _ := r.PTR(ctx, fqdn, nil, records, zones)
+	ns, _ := r.NS(ctx, fqdn, nil, records, zones)
+	mx, _ := r.MX(ctx, fqdn, nil, records, zones)
+	srv, _ := r.SRV(ctx, fqdn, nil, records, zones)
+	rrs = append(rrs, a...)
+	rrs = append(rrs, aaaa...)
+	rrs = append(rrs, cname...)
+	rrs = append(rrs, txt...)
+	rrs = append(rrs, caa...)
+	rrs = append(rrs, ptr...)
+	rrs = append(rrs, ns...)
+	rrs = append(rrs, mx...)
+	rrs = append(rrs, srv...)
+	return rrs
+}